@@ -3,10 +3,16 @@ package agent
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang/snappy"
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/go-msgpack/codec"
 	cstructs "github.com/hashicorp/nomad/client/structs"
 	"github.com/hashicorp/nomad/nomad/structs"
 )
@@ -16,6 +22,15 @@ const (
 	resourceNotFoundErr = "resource not found"
 )
 
+// execUpgrader upgrades the HTTP connection backing /exec requests to a
+// WebSocket. Origin checking is left to the caller's ACL/token validation,
+// same as the rest of the client HTTP API.
+var execUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
 func (s *HTTPServer) AllocsRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	if req.Method != "GET" {
 		return nil, CodedError(405, ErrInvalidMethod)
@@ -59,6 +74,10 @@ func (s *HTTPServer) AllocSpecificRequest(resp http.ResponseWriter, req *http.Re
 	switch tokens[1] {
 	case "stop":
 		return s.allocStop(allocID, resp, req)
+	case "pause":
+		return s.allocPause(allocID, resp, req)
+	case "resume":
+		return s.allocResume(allocID, resp, req)
 	}
 
 	return nil, CodedError(404, resourceNotFoundErr)
@@ -116,6 +135,46 @@ func (s *HTTPServer) allocStop(allocID string, resp http.ResponseWriter, req *ht
 	return &out, err
 }
 
+// allocPause freezes every task in the allocation by recording a paused
+// desired state, same as allocStop records a stopped one. The actual
+// SIGSTOP delivery to the running tasks happens on the client side, see
+// allocPauseTask.
+//
+// This is the HTTP-layer half of the feature: the "Alloc.Pause" server RPC,
+// the paused-task-state bookkeeping, and the disable_pause task option still
+// need to be added in the nomad/client packages before this has anything to
+// call.
+func (s *HTTPServer) allocPause(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	sr := &structs.AllocPauseRequest{
+		AllocID: allocID,
+	}
+	s.parseWriteRequest(req, &sr.WriteRequest)
+
+	var out structs.AllocPauseResponse
+	err := s.agent.RPC("Alloc.Pause", &sr, &out)
+	return &out, err
+}
+
+// allocResume is the inverse of allocPause.
+func (s *HTTPServer) allocResume(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	sr := &structs.AllocResumeRequest{
+		AllocID: allocID,
+	}
+	s.parseWriteRequest(req, &sr.WriteRequest)
+
+	var out structs.AllocResumeResponse
+	err := s.agent.RPC("Alloc.Resume", &sr, &out)
+	return &out, err
+}
+
 func (s *HTTPServer) ClientAllocRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	reqSuffix := strings.TrimPrefix(req.URL.Path, "/v1/client/allocation/")
 
@@ -140,6 +199,12 @@ func (s *HTTPServer) ClientAllocRequest(resp http.ResponseWriter, req *http.Requ
 		return s.allocGC(allocID, resp, req)
 	case "signal":
 		return s.allocSignal(allocID, resp, req)
+	case "exec":
+		return s.allocExec(allocID, resp, req)
+	case "pause":
+		return s.allocPauseTask(allocID, resp, req)
+	case "resume":
+		return s.allocResumeTask(allocID, resp, req)
 	}
 
 	return nil, CodedError(404, resourceNotFoundErr)
@@ -225,6 +290,121 @@ func (s *HTTPServer) allocRestart(allocID string, resp http.ResponseWriter, req
 	return reply, rpcErr
 }
 
+// allocPauseTask freezes a single task within the allocation via SIGSTOP, or
+// every task if the request body omits TaskName. This is the client-side
+// counterpart to allocPause: it acts on the running task immediately instead
+// of recording a desired state for the server to reconcile.
+//
+// This is the HTTP-layer half of the feature: the "Allocations.Pause" client
+// RPC, the driver-level SIGSTOP signal path, and the alloc-lifecycle ACL
+// capability check still need to be added in the client/driver/ACL packages
+// before this handler has a real RPC to reach.
+func (s *HTTPServer) allocPauseTask(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	// Build the request and parse the ACL token
+	args := structs.AllocPauseTaskRequest{
+		AllocID:  allocID,
+		TaskName: "",
+	}
+	s.parse(resp, req, &args.QueryOptions.Region, &args.QueryOptions)
+
+	// Explicitly parse the body separately to disallow overriding AllocID in
+	// req Body. A pause with no body is the common "freeze everything" case,
+	// so an empty body must not be treated as a decode error.
+	var reqBody struct {
+		TaskName string
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		if err := decodeBody(req, &reqBody); err != nil && err != io.EOF {
+			return nil, CodedError(400, fmt.Sprintf("Failed to decode body: %v", err))
+		}
+	}
+	if reqBody.TaskName != "" {
+		args.TaskName = reqBody.TaskName
+	}
+
+	// Determine the handler to use
+	useLocalClient, useClientRPC, useServerRPC := s.rpcHandlerForAlloc(allocID)
+
+	// Make the RPC
+	var reply structs.GenericResponse
+	var rpcErr error
+	if useLocalClient {
+		rpcErr = s.agent.Client().ClientRPC("Allocations.Pause", &args, &reply)
+	} else if useClientRPC {
+		rpcErr = s.agent.Client().RPC("ClientAllocations.Pause", &args, &reply)
+	} else if useServerRPC {
+		rpcErr = s.agent.Server().RPC("ClientAllocations.Pause", &args, &reply)
+	} else {
+		rpcErr = CodedError(400, "No local Node and node_id not provided")
+	}
+
+	if rpcErr != nil {
+		if structs.IsErrNoNodeConn(rpcErr) || structs.IsErrUnknownAllocation(rpcErr) {
+			rpcErr = CodedError(404, rpcErr.Error())
+		}
+	}
+
+	return reply, rpcErr
+}
+
+// allocResumeTask is the inverse of allocPauseTask: it sends SIGCONT to the
+// named task (or every task) and restores the prior task state.
+func (s *HTTPServer) allocResumeTask(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if !(req.Method == "POST" || req.Method == "PUT") {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	// Build the request and parse the ACL token
+	args := structs.AllocResumeTaskRequest{
+		AllocID:  allocID,
+		TaskName: "",
+	}
+	s.parse(resp, req, &args.QueryOptions.Region, &args.QueryOptions)
+
+	// Explicitly parse the body separately to disallow overriding AllocID in
+	// req Body. A resume with no body is the common "restore everything"
+	// case, so an empty body must not be treated as a decode error.
+	var reqBody struct {
+		TaskName string
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		if err := decodeBody(req, &reqBody); err != nil && err != io.EOF {
+			return nil, CodedError(400, fmt.Sprintf("Failed to decode body: %v", err))
+		}
+	}
+	if reqBody.TaskName != "" {
+		args.TaskName = reqBody.TaskName
+	}
+
+	// Determine the handler to use
+	useLocalClient, useClientRPC, useServerRPC := s.rpcHandlerForAlloc(allocID)
+
+	// Make the RPC
+	var reply structs.GenericResponse
+	var rpcErr error
+	if useLocalClient {
+		rpcErr = s.agent.Client().ClientRPC("Allocations.Resume", &args, &reply)
+	} else if useClientRPC {
+		rpcErr = s.agent.Client().RPC("ClientAllocations.Resume", &args, &reply)
+	} else if useServerRPC {
+		rpcErr = s.agent.Server().RPC("ClientAllocations.Resume", &args, &reply)
+	} else {
+		rpcErr = CodedError(400, "No local Node and node_id not provided")
+	}
+
+	if rpcErr != nil {
+		if structs.IsErrNoNodeConn(rpcErr) || structs.IsErrUnknownAllocation(rpcErr) {
+			rpcErr = CodedError(404, rpcErr.Error())
+		}
+	}
+
+	return reply, rpcErr
+}
+
 func (s *HTTPServer) allocGC(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	// Build the request and parse the ACL token
 	args := structs.AllocSpecificRequest{
@@ -296,6 +476,20 @@ func (s *HTTPServer) allocSignal(allocID string, resp http.ResponseWriter, req *
 	return reply, rpcErr
 }
 
+// allocRunnerGCd reports whether allocID's AllocRunner has been torn down by
+// local client GC even though this node still has an alloc record for it
+// (the server hasn't GC'd the alloc yet, so requests for it keep arriving
+// here). GetAllocFS and the various Stats calls don't return a typed
+// IsErrUnknownAllocation in this case - the runner is found, just destroyed
+// - so callers that want a 404 instead of a generic 500 need to check this
+// explicitly before touching the runner's filesystem or stats collector.
+// AllocRunnerIsDestroyed is exported on client.Client for exactly this; it
+// does the getAllocRunner lookup and IsDestroyed check on our behalf so this
+// package doesn't reach into client internals.
+func (s *HTTPServer) allocRunnerGCd(allocID string) bool {
+	return s.agent.Client().AllocRunnerIsDestroyed(allocID)
+}
+
 func (s *HTTPServer) allocSnapshot(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	var secret string
 	s.parseToken(req, &secret)
@@ -303,11 +497,21 @@ func (s *HTTPServer) allocSnapshot(allocID string, resp http.ResponseWriter, req
 		return nil, structs.ErrPermissionDenied
 	}
 
+	if s.allocRunnerGCd(allocID) {
+		return nil, CodedError(404, "allocation files were garbage collected")
+	}
+
 	allocFS, err := s.agent.Client().GetAllocFS(allocID)
 	if err != nil {
+		if structs.IsErrUnknownAllocation(err) {
+			return nil, CodedError(404, allocNotFoundErr)
+		}
 		return nil, fmt.Errorf(allocNotFoundErr)
 	}
 	if err := allocFS.Snapshot(resp); err != nil {
+		if structs.IsErrUnknownAllocation(err) {
+			return nil, CodedError(404, "allocation files were garbage collected")
+		}
 		return nil, fmt.Errorf("error making snapshot: %v", err)
 	}
 	return nil, nil
@@ -323,9 +527,17 @@ func (s *HTTPServer) allocStats(allocID string, resp http.ResponseWriter, req *h
 	}
 	s.parse(resp, req, &args.QueryOptions.Region, &args.QueryOptions)
 
+	if stream, _ := strconv.ParseBool(req.URL.Query().Get("stream")); stream {
+		return s.allocStatsStream(allocID, resp, req, &args)
+	}
+
 	// Determine the handler to use
 	useLocalClient, useClientRPC, useServerRPC := s.rpcHandlerForAlloc(allocID)
 
+	if useLocalClient && s.allocRunnerGCd(allocID) {
+		return nil, CodedError(404, "allocation files were garbage collected")
+	}
+
 	// Make the RPC
 	var reply cstructs.AllocStatsResponse
 	var rpcErr error
@@ -347,3 +559,233 @@ func (s *HTTPServer) allocStats(allocID string, resp http.ResponseWriter, req *h
 
 	return reply.Stats, rpcErr
 }
+
+// allocStatsStream is the counterpart to allocStats for callers that want a
+// live subscription instead of a one-shot sample. It opens a streaming RPC
+// against the TaskRunner stats collector on the owning client and writes one
+// AllocResourceUsage frame per collection interval directly to resp, JSON by
+// default or msgpack when the caller sends an `Accept: application/msgpack`
+// header.
+//
+// This is the HTTP-layer half of the feature: "Allocations.StatsStream" and
+// the TaskRunner-backed collector it talks to belong to the client package
+// and still need to be registered there before this handler has anything to
+// reach.
+func (s *HTTPServer) allocStatsStream(allocID string, resp http.ResponseWriter, req *http.Request, args *cstructs.AllocStatsRequest) (interface{}, error) {
+	interval := time.Second
+	if raw := req.URL.Query().Get("interval"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, CodedError(400, fmt.Sprintf("invalid interval: %v", err))
+		}
+		if d <= 0 {
+			return nil, CodedError(400, fmt.Sprintf("interval must be positive: %v", raw))
+		}
+		interval = d
+	}
+
+	streamArgs := cstructs.AllocStatsStreamRequest{
+		AllocStatsRequest: *args,
+		Interval:          interval,
+	}
+
+	useLocalClient, useClientRPC, useServerRPC := s.rpcHandlerForAlloc(allocID)
+
+	if useLocalClient && s.allocRunnerGCd(allocID) {
+		return nil, CodedError(404, "allocation files were garbage collected")
+	}
+
+	var handler structs.StreamingRpcHandler
+	var handlerErr error
+	switch {
+	case useLocalClient:
+		handler, handlerErr = s.agent.Client().StreamingRpcHandler("Allocations.StatsStream")
+	case useClientRPC:
+		handler, handlerErr = s.agent.Client().RemoteStreamingRpcHandler("Allocations.StatsStream")
+	case useServerRPC:
+		handler, handlerErr = s.agent.Server().StreamingRpcHandler("Allocations.StatsStream")
+	default:
+		handlerErr = CodedError(400, "No local Node and node_id not provided")
+	}
+	if handlerErr != nil {
+		if structs.IsErrNoNodeConn(handlerErr) || structs.IsErrUnknownAllocation(handlerErr) {
+			handlerErr = CodedError(404, handlerErr.Error())
+		}
+		return nil, handlerErr
+	}
+
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		return nil, CodedError(500, "streaming not supported by underlying transport")
+	}
+
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+
+	decoder := codec.NewDecoder(p1, structs.MsgpackHandle)
+	encoder := codec.NewEncoder(p1, structs.MsgpackHandle)
+
+	go handler(p2)
+
+	if err := encoder.Encode(&streamArgs); err != nil {
+		return nil, CodedError(500, err.Error())
+	}
+
+	useMsgpack := strings.Contains(req.Header.Get("Accept"), "application/msgpack")
+	if useMsgpack {
+		resp.Header().Set("Content-Type", "application/msgpack")
+	} else {
+		resp.Header().Set("Content-Type", "application/json")
+	}
+	resp.WriteHeader(http.StatusOK)
+
+	for {
+		var frame cstructs.AllocResourceUsage
+		if err := decoder.Decode(&frame); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, CodedError(500, err.Error())
+		}
+
+		var encErr error
+		if useMsgpack {
+			encErr = codec.NewEncoder(resp, structs.MsgpackHandle).Encode(&frame)
+		} else {
+			encErr = json.NewEncoder(resp).Encode(&frame)
+		}
+		if encErr != nil {
+			return nil, nil
+		}
+		flusher.Flush()
+	}
+}
+
+// allocExec upgrades the connection to a WebSocket and pumps an interactive
+// exec session between the caller and the alloc's owning client, dispatching
+// through the same local/client/server RPC trichotomy as the rest of this
+// file. The handler checks no ACL capability itself; it parses the ACL token
+// and passes it on with the RPC request.
+//
+// This is the HTTP-layer half of the feature: "Allocations.Exec" itself, the
+// driver-level exec plumbing it calls into, and the alloc-exec ACL capability
+// check still need to be added in the client/driver/ACL packages before this
+// handler has a real RPC to reach.
+func (s *HTTPServer) allocExec(allocID string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	q := req.URL.Query()
+
+	var command []string
+	if raw := q.Get("command"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &command); err != nil {
+			return nil, CodedError(400, fmt.Sprintf("failed to parse command: %v", err))
+		}
+	}
+
+	var tty bool
+	if raw := q.Get("tty"); raw != "" {
+		var err error
+		tty, err = strconv.ParseBool(raw)
+		if err != nil {
+			return nil, CodedError(400, fmt.Sprintf("tty must be a bool: %v", raw))
+		}
+	}
+
+	args := cstructs.AllocExecRequest{
+		AllocID: allocID,
+		Task:    q.Get("task"),
+		Cmd:     command,
+		Tty:     tty,
+	}
+	s.parse(resp, req, &args.QueryOptions.Region, &args.QueryOptions)
+
+	// Resolve the streaming handler before upgrading the connection, same as
+	// allocStatsStream does: a 404/400 for an unknown alloc or unreachable
+	// node should come back as a normal HTTP error, not a 101 followed by an
+	// in-band error frame.
+	useLocalClient, useClientRPC, useServerRPC := s.rpcHandlerForAlloc(allocID)
+
+	var handler structs.StreamingRpcHandler
+	var handlerErr error
+	switch {
+	case useLocalClient:
+		handler, handlerErr = s.agent.Client().StreamingRpcHandler("Allocations.Exec")
+	case useClientRPC:
+		handler, handlerErr = s.agent.Client().RemoteStreamingRpcHandler("Allocations.Exec")
+	case useServerRPC:
+		handler, handlerErr = s.agent.Server().StreamingRpcHandler("Allocations.Exec")
+	default:
+		handlerErr = CodedError(400, "No local Node and node_id not provided")
+	}
+	if handlerErr != nil {
+		if structs.IsErrNoNodeConn(handlerErr) || structs.IsErrUnknownAllocation(handlerErr) {
+			handlerErr = CodedError(404, handlerErr.Error())
+		}
+		return nil, handlerErr
+	}
+
+	conn, err := execUpgrader.Upgrade(resp, req, nil)
+	if err != nil {
+		return nil, CodedError(400, fmt.Sprintf("failed to upgrade connection: %v", err))
+	}
+	defer conn.Close()
+
+	execStreamRpc(conn, handler, &args)
+	return nil, nil
+}
+
+// execStreamRpc wires a WebSocket connection to a streaming RPC handler,
+// translating each side's frames through the ugorji msgpack handle the rest
+// of the RPC layer uses. Stdin, resize, and exit-code frames all flow over
+// the same connection; the pump exits when either side closes or errors.
+func execStreamRpc(conn *websocket.Conn, handler structs.StreamingRpcHandler, args *cstructs.AllocExecRequest) {
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+
+	decoder := codec.NewDecoder(p1, structs.MsgpackHandle)
+	encoder := codec.NewEncoder(p1, structs.MsgpackHandle)
+
+	go handler(p2)
+
+	if err := encoder.Encode(args); err != nil {
+		conn.WriteJSON(&cstructs.ExecStreamingOutput{Error: err.Error()})
+		return
+	}
+
+	errCh := make(chan error, 2)
+
+	go func() {
+		for {
+			var frame cstructs.ExecStreamingOutput
+			if err := decoder.Decode(&frame); err != nil {
+				if err != io.EOF {
+					errCh <- err
+				} else {
+					errCh <- nil
+				}
+				return
+			}
+			if err := conn.WriteJSON(&frame); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			var frame cstructs.ExecStreamingInput
+			if err := conn.ReadJSON(&frame); err != nil {
+				errCh <- err
+				return
+			}
+			if err := encoder.Encode(&frame); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	if err := <-errCh; err != nil {
+		conn.WriteJSON(&cstructs.ExecStreamingOutput{Error: err.Error()})
+	}
+}
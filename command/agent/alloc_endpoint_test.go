@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/nomad/mock"
+	"github.com/hashicorp/nomad/nomad/structs"
+	"github.com/hashicorp/nomad/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// NOTE: "Allocations.Exec" is not yet registered anywhere in this tree (see
+// the dependency note on allocExec), so these tests can only exercise HTTP
+// plumbing - ordering of handler resolution vs. upgrade - not real exec I/O,
+// resize, or exit codes. They should be replaced
+// with tests against a fake StreamingRpcHandler once that RPC exists.
+
+// TestHTTP_AllocExec_Local covers the path where the agent answering the
+// HTTP request is also the client that owns the allocation, so allocExec
+// dispatches straight to the local StreamingRpcHandler. It also guards the
+// ordering fix: resolving the handler happens before the WebSocket upgrade,
+// so a handler-resolution failure (expected here, since the RPC isn't wired
+// up) must surface as a normal HTTP error rather than a 101 followed by an
+// in-band error frame.
+func TestHTTP_AllocExec_Local(t *testing.T) {
+	httpTest(t, nil, func(s *TestAgent) {
+		alloc := mock.Alloc()
+		require.NoError(t, s.Agent.Client().AddAlloc(alloc, ""))
+
+		req, err := http.NewRequest("GET", "/v1/client/allocation/"+alloc.ID+"/exec?task=web&command=%5B%22echo%22%5D", nil)
+		require.NoError(t, err)
+		respW := httptest.NewRecorder()
+
+		_, err = s.Server.allocExec(alloc.ID, respW, req)
+		require.Error(t, err)
+		_, isCoded := err.(HTTPCodedError)
+		require.True(t, isCoded, "expected a CodedError, got raw error: %v", err)
+		require.NotEqual(t, http.StatusSwitchingProtocols, respW.Code)
+	})
+}
+
+// TestHTTP_AllocExec_RemoteClient covers a client agent that does not own
+// the alloc locally and has to hop to the server via ClientRPC/RemoteStreamingRpcHandler.
+func TestHTTP_AllocExec_RemoteClient(t *testing.T) {
+	server := NewTestAgent(t, t.Name()+"-server", nil)
+	defer server.Shutdown()
+	testutil.WaitForLeader(t, server.Agent.RPC)
+
+	client := NewTestAgent(t, t.Name()+"-client", func(c *Config) {
+		c.Server.Enabled = false
+		c.Client.Servers = []string{server.Server.Addr}
+	})
+	defer client.Shutdown()
+
+	alloc := mock.Alloc()
+	state := server.Agent.server.State()
+	require.NoError(t, state.UpsertJobSummary(999, mock.JobSummary(alloc.JobID)))
+	require.NoError(t, state.UpsertAllocs(1000, []*structs.Allocation{alloc}))
+
+	req, err := http.NewRequest("GET", "/v1/client/allocation/"+alloc.ID+"/exec", nil)
+	require.NoError(t, err)
+	respW := httptest.NewRecorder()
+
+	_, err = client.Server.allocExec(alloc.ID, respW, req)
+	require.Error(t, err)
+	require.NotEqual(t, http.StatusSwitchingProtocols, respW.Code)
+}
+
+// TestHTTP_AllocExec_ForwardedServer covers a server agent proxying the
+// streaming RPC to whichever node owns the alloc via StreamingRpcHandler.
+func TestHTTP_AllocExec_ForwardedServer(t *testing.T) {
+	httpTest(t, nil, func(s *TestAgent) {
+		alloc := mock.Alloc()
+		state := s.Agent.server.State()
+		require.NoError(t, state.UpsertJobSummary(999, mock.JobSummary(alloc.JobID)))
+		require.NoError(t, state.UpsertAllocs(1000, []*structs.Allocation{alloc}))
+
+		req, err := http.NewRequest("GET", "/v1/client/allocation/"+alloc.ID+"/exec", nil)
+		require.NoError(t, err)
+		respW := httptest.NewRecorder()
+
+		_, err = s.Server.allocExec(alloc.ID, respW, req)
+		require.Error(t, err)
+		require.NotEqual(t, http.StatusSwitchingProtocols, respW.Code)
+	})
+}
+
+// TestHTTP_AllocStats_Stream exercises the `?stream=true` counterpart to a
+// one-shot allocStats call: it should pick a Content-Type up front and write
+// frames as they arrive rather than buffering a single response.
+func TestHTTP_AllocStats_Stream(t *testing.T) {
+	httpTest(t, nil, func(s *TestAgent) {
+		alloc := mock.Alloc()
+		require.NoError(t, s.Agent.Client().AddAlloc(alloc, ""))
+
+		req, err := http.NewRequest("GET", "/v1/client/allocation/"+alloc.ID+"/stats?stream=true&interval=10ms", nil)
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(req.Context(), 200*time.Millisecond)
+		defer cancel()
+		req = req.WithContext(ctx)
+
+		respW := httptest.NewRecorder()
+		_, _ = s.Server.allocStats(alloc.ID, respW, req)
+
+		require.NotEmpty(t, respW.Header().Get("Content-Type"))
+	})
+}
+
+// TestHTTP_AllocStats_GCdAlloc404 and TestHTTP_AllocSnapshot_GCdAlloc404
+// cover a locally GC'd allocation whose AllocRunner has been destroyed on
+// this node while the local client still holds the alloc record. That combination used to bubble up as a generic 500 from
+// GetAllocFS/Stats; it must now come back as a 404.
+func TestHTTP_AllocStats_GCdAlloc404(t *testing.T) {
+	httpTest(t, nil, func(s *TestAgent) {
+		alloc := mock.Alloc()
+		require.NoError(t, s.Agent.Client().AddAlloc(alloc, ""))
+		require.NoError(t, s.Agent.Client().CollectAllocation(alloc.ID))
+
+		req, err := http.NewRequest("GET", "/v1/client/allocation/"+alloc.ID+"/stats", nil)
+		require.NoError(t, err)
+		respW := httptest.NewRecorder()
+
+		_, err = s.Server.allocStats(alloc.ID, respW, req)
+		require.Error(t, err)
+		coded, ok := err.(HTTPCodedError)
+		require.True(t, ok)
+		require.Equal(t, 404, coded.Code())
+	})
+}
+
+func TestHTTP_AllocSnapshot_GCdAlloc404(t *testing.T) {
+	httpTest(t, nil, func(s *TestAgent) {
+		alloc := mock.Alloc()
+		require.NoError(t, s.Agent.Client().AddAlloc(alloc, ""))
+		require.NoError(t, s.Agent.Client().CollectAllocation(alloc.ID))
+
+		req, err := http.NewRequest("GET", "/v1/client/allocation/"+alloc.ID+"/snapshot", nil)
+		require.NoError(t, err)
+		respW := httptest.NewRecorder()
+
+		_, err = s.Server.allocSnapshot(alloc.ID, respW, req)
+		require.Error(t, err)
+		coded, ok := err.(HTTPCodedError)
+		require.True(t, ok)
+		require.Equal(t, 404, coded.Code())
+	})
+}
+
+// NOTE: "Alloc.Pause"/"Alloc.Resume" and "Allocations.Pause"/"Allocations.Resume"
+// aren't registered anywhere in this tree yet (see the dependency notes on
+// allocPause/allocPauseTask), so the tests below only cover body-decoding:
+// that an empty body is treated as "every task" rather than a decode error.
+// They don't exercise SIGSTOP/SIGCONT delivery or paused task-state
+// persistence - that needs tests against a fake RPC once the backend lands.
+
+// TestHTTP_AllocPauseTask_EmptyBody is the regression test for the "pause
+// everything" case: POSTing with no body at all used to bubble up a raw
+// io.EOF instead of treating the omitted TaskName as "every task".
+func TestHTTP_AllocPauseTask_EmptyBody(t *testing.T) {
+	httpTest(t, nil, func(s *TestAgent) {
+		alloc := mock.Alloc()
+		require.NoError(t, s.Agent.Client().AddAlloc(alloc, ""))
+
+		req, err := http.NewRequest("POST", "/v1/client/allocation/"+alloc.ID+"/pause", nil)
+		require.NoError(t, err)
+		respW := httptest.NewRecorder()
+
+		_, err = s.Server.allocPauseTask(alloc.ID, respW, req)
+		if err != nil {
+			_, isCoded := err.(HTTPCodedError)
+			require.True(t, isCoded, "expected a CodedError, got raw error: %v", err)
+			require.NotContains(t, err.Error(), "Failed to decode body")
+		}
+	})
+}
+
+// TestHTTP_AllocResumeTask_EmptyBody mirrors TestHTTP_AllocPauseTask_EmptyBody
+// for the resume endpoint.
+func TestHTTP_AllocResumeTask_EmptyBody(t *testing.T) {
+	httpTest(t, nil, func(s *TestAgent) {
+		alloc := mock.Alloc()
+		require.NoError(t, s.Agent.Client().AddAlloc(alloc, ""))
+
+		req, err := http.NewRequest("POST", "/v1/client/allocation/"+alloc.ID+"/resume", nil)
+		require.NoError(t, err)
+		respW := httptest.NewRecorder()
+
+		_, err = s.Server.allocResumeTask(alloc.ID, respW, req)
+		if err != nil {
+			_, isCoded := err.(HTTPCodedError)
+			require.True(t, isCoded, "expected a CodedError, got raw error: %v", err)
+			require.NotContains(t, err.Error(), "Failed to decode body")
+		}
+	})
+}
+
+// TestHTTP_AllocPause_EmptyBody covers the whole-allocation (AllocSpecificRequest)
+// pause endpoint with no body, parallel to allocStop's WriteRequest handling.
+func TestHTTP_AllocPause_EmptyBody(t *testing.T) {
+	httpTest(t, nil, func(s *TestAgent) {
+		alloc := mock.Alloc()
+		state := s.Agent.server.State()
+		require.NoError(t, state.UpsertJobSummary(999, mock.JobSummary(alloc.JobID)))
+		require.NoError(t, state.UpsertAllocs(1000, []*structs.Allocation{alloc}))
+
+		req, err := http.NewRequest("POST", "/v1/allocation/"+alloc.ID+"/pause", nil)
+		require.NoError(t, err)
+		respW := httptest.NewRecorder()
+
+		_, err = s.Server.allocPause(alloc.ID, respW, req)
+		if err != nil {
+			_, isCoded := err.(HTTPCodedError)
+			require.True(t, isCoded, "expected a CodedError, got raw error: %v", err)
+		}
+	})
+}